@@ -0,0 +1,158 @@
+package etchosts
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// defaultBackupGenerations is how many rotated snapshots are kept per hosts
+// file when backups are enabled and the caller hasn't overridden the count
+// with SetBackupGenerations.
+const defaultBackupGenerations = 5
+
+var (
+	backupMu          sync.Mutex
+	backupDir         string
+	backupGenerations = defaultBackupGenerations
+)
+
+// SetBackupDir enables automatic backups of hosts files mutated through this
+// package. Before every mutating call, the current contents of the target
+// file are snapshotted into dir, rotating previous snapshots so that at
+// most backupGenerations are kept. Passing an empty dir disables backups,
+// which is the default.
+func SetBackupDir(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	backupMu.Lock()
+	backupDir = dir
+	backupMu.Unlock()
+	return nil
+}
+
+// SetBackupGenerations changes how many rotated snapshots are kept per
+// hosts file. It has no effect until SetBackupDir has been called.
+func SetBackupGenerations(n int) {
+	backupMu.Lock()
+	backupGenerations = n
+	backupMu.Unlock()
+}
+
+// backupPath returns the path of the generation-th snapshot of path, where
+// generation 1 is the most recent. The name includes a hash of path, so
+// files with the same base name in different directories do not share
+// snapshots.
+func backupPath(dir, path string, generation int) string {
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(dir, fmt.Sprintf("%s-%x.%d.bak", filepath.Base(path), sum[:8], generation))
+}
+
+// snapshot copies the current contents of path into the backup directory,
+// rotating older generations out. It is a no-op if no backup directory has
+// been configured. The caller must hold the per-path mutex.
+func snapshot(path string) error {
+	backupMu.Lock()
+	dir, generations := backupDir, backupGenerations
+	backupMu.Unlock()
+	if dir == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for gen := generations; gen >= 2; gen-- {
+		older, newer := backupPath(dir, path, gen), backupPath(dir, path, gen-1)
+		if _, err := os.Stat(newer); err != nil {
+			continue
+		}
+		if err := os.Rename(newer, older); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(backupPath(dir, path, 1), content, 0o644)
+}
+
+// restoreLatest rolls path back to the snapshot taken by the most recent
+// call to snapshot, undoing a failed write. It is a no-op if no backup
+// directory has been configured. The caller must hold the per-path mutex.
+func restoreLatest(path string) error {
+	backupMu.Lock()
+	dir := backupDir
+	backupMu.Unlock()
+	if dir == "" {
+		return nil
+	}
+
+	return restoreFrom(backupPath(dir, path, 1), path)
+}
+
+// Restore replaces the hosts file at path with the snapshot identified by
+// generation, where 1 is the most recent. SetBackupDir must have been
+// called with the directory those snapshots live in.
+func Restore(path string, generation int) error {
+	backupMu.Lock()
+	dir := backupDir
+	backupMu.Unlock()
+	if dir == "" {
+		return fmt.Errorf("etchosts: no backup directory configured")
+	}
+
+	m := mutexForPath(path)
+	m.Lock()
+	defer m.Unlock()
+
+	return restoreFrom(backupPath(dir, path, generation), path)
+}
+
+func restoreFrom(backup, path string) error {
+	content, err := os.ReadFile(backup)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, existingMode(path))
+}
+
+// existingMode returns the current permissions of path, or 0o644 if it
+// doesn't exist yet. Writes that replace or restore path should use this
+// instead of a hardcoded mode, so they never silently change permissions
+// a caller set on the file.
+func existingMode(path string) os.FileMode {
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode()
+	}
+	return 0o644
+}
+
+// writeFile is the common tail of every mutating call: it snapshots the
+// current contents of path for crash recovery, writes data, and restores
+// the snapshot if the write fails. Snapshots and restores only happen when
+// a backup directory has been set with SetBackupDir; without one, a failed
+// write can leave path truncated or half-written.
+func writeFile(path string, data []byte) error {
+	if err := snapshot(path); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, existingMode(path)); err != nil {
+		// Best effort: prefer returning the original write error even if
+		// the restore itself fails.
+		_ = restoreLatest(path)
+		return err
+	}
+
+	return nil
+}
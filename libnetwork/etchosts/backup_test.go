@@ -0,0 +1,105 @@
+package etchosts
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, SetBackupDir(dir))
+	defer SetBackupDir("")
+
+	file := filepath.Join(t.TempDir(), "hosts")
+	assert.NilError(t, Build(file, nil))
+
+	assert.NilError(t, Add(file, []Record{
+		{Hosts: "testhostname", IP: netip.MustParseAddr("1.1.1.1")},
+	}))
+
+	// The snapshot taken before the next Add should match the file's
+	// contents as of right now, i.e. before "other" is added.
+	assert.NilError(t, Add(file, []Record{
+		{Hosts: "other", IP: netip.MustParseAddr("2.2.2.2")},
+	}))
+
+	snap, err := os.ReadFile(backupPath(dir, file, 1))
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(snap), "testhostname"))
+	assert.Check(t, !strings.Contains(string(snap), "other"))
+
+	assert.NilError(t, Restore(file, 1))
+	content, err := os.ReadFile(file)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(content), "testhostname"))
+	assert.Check(t, !strings.Contains(string(content), "other"))
+}
+
+func TestBackupRotation(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, SetBackupDir(dir))
+	defer SetBackupDir("")
+	SetBackupGenerations(2)
+	defer SetBackupGenerations(defaultBackupGenerations)
+
+	file := filepath.Join(t.TempDir(), "hosts")
+	assert.NilError(t, Build(file, nil))
+
+	for i := 0; i < 3; i++ {
+		assert.NilError(t, Add(file, []Record{
+			{Hosts: "testhostname", IP: netip.MustParseAddr("1.1.1.1")},
+		}))
+	}
+
+	assert.Check(t, fileExists(backupPath(dir, file, 1)))
+	assert.Check(t, fileExists(backupPath(dir, file, 2)))
+	assert.Check(t, !fileExists(backupPath(dir, file, 3)))
+}
+
+func TestWriteFilePreservesFileMode(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	assert.NilError(t, Build(file, []Record{
+		{Hosts: "testhostname", IP: netip.MustParseAddr("1.1.1.1")},
+	}))
+	assert.NilError(t, os.Chmod(file, 0o640))
+
+	assert.NilError(t, Update(file, "9.9.9.9", "testhostname"))
+
+	info, err := os.Stat(file)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(info.Mode().Perm(), os.FileMode(0o640)))
+}
+
+func TestRestorePreservesFileMode(t *testing.T) {
+	dir := t.TempDir()
+	assert.NilError(t, SetBackupDir(dir))
+	defer SetBackupDir("")
+
+	file := filepath.Join(t.TempDir(), "hosts")
+	assert.NilError(t, Build(file, nil))
+	assert.NilError(t, os.Chmod(file, 0o640))
+
+	assert.NilError(t, Add(file, []Record{
+		{Hosts: "testhostname", IP: netip.MustParseAddr("1.1.1.1")},
+	}))
+	// Simulate an operator or a different caller narrowing permissions
+	// after the mutation; Restore must not silently widen them back.
+	assert.NilError(t, os.Chmod(file, 0o600))
+
+	assert.NilError(t, Restore(file, 1))
+
+	info, err := os.Stat(file)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(info.Mode().Perm(), os.FileMode(0o600)))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
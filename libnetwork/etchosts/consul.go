@@ -0,0 +1,228 @@
+package etchosts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ConsulSource is a Source that resolves a set of Consul services to their
+// catalog addresses, re-querying via a Consul blocking query whenever the
+// catalog's index changes.
+type ConsulSource struct {
+	// Addr is the address of the Consul HTTP API, e.g. "127.0.0.1:8500".
+	Addr string
+	// Services maps the hostname to add to /etc/hosts to the name of the
+	// Consul service whose instances should resolve to it.
+	Services map[string]string
+	// HTTPClient is used for all requests to Consul. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+	// WaitTime is the duration requested for each blocking query. If zero,
+	// a 5 minute wait is requested.
+	WaitTime time.Duration
+}
+
+type consulCatalogEntry struct {
+	ServiceAddress string
+	Address        string
+}
+
+// Records resolves every configured service once, without waiting for
+// changes.
+func (s *ConsulSource) Records(ctx context.Context) ([]Record, error) {
+	records := make(map[string][]Record, len(s.Services))
+	for host, service := range s.Services {
+		entries, _, err := s.catalogService(ctx, service, 0)
+		if err != nil {
+			return nil, err
+		}
+		records[host] = toRecords(host, entries)
+	}
+	return mergeRecords(records), nil
+}
+
+// consulUpdate carries one service's freshly resolved records from a
+// watchService goroutine to the Watch aggregator.
+type consulUpdate struct {
+	host    string
+	records []Record
+}
+
+// Watch polls Consul's blocking query API and sends the full, merged
+// record set whenever any configured service's catalog entries change.
+// Each service is watched on its own goroutine with its own index, since
+// Consul's X-Consul-Index is meaningless when carried over from a
+// different service's query: reusing the maximum index across services
+// would make a quiet service block for the full wait duration on every
+// cycle, stalling detection of changes on a busier one.
+func (s *ConsulSource) Watch(ctx context.Context) (<-chan []Record, error) {
+	current := make(map[string][]Record, len(s.Services))
+	startIndex := make(map[string]uint64, len(s.Services))
+	for host, service := range s.Services {
+		entries, index, err := s.catalogService(ctx, service, 0)
+		if err != nil {
+			return nil, err
+		}
+		current[host] = toRecords(host, entries)
+		startIndex[host] = index
+	}
+
+	updates := make(chan consulUpdate)
+	for host, service := range s.Services {
+		go s.watchService(ctx, host, service, startIndex[host], updates)
+	}
+
+	ch := make(chan []Record, 1)
+	ch <- mergeRecords(current)
+
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case u := <-updates:
+				current[u.host] = u.records
+				select {
+				case ch <- mergeRecords(current):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// watchService repeatedly issues blocking queries for service, carrying its
+// own index forward independently of every other watched service, and
+// sends the resolved records to updates only when Consul reports an actual
+// change. A blocking query that simply times out returns the same index
+// and data it was called with, and must not produce an update: otherwise a
+// quiet service would still emit (and have synced to disk) a no-op
+// rewrite every WaitTime. It returns once ctx is done.
+func (s *ConsulSource) watchService(ctx context.Context, host, service string, index uint64, updates chan<- consulUpdate) {
+	for {
+		entries, nextIndex, err := s.catalogService(ctx, service, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case nextIndex < index:
+			// Consul's index went backwards, e.g. it was reset by a
+			// server-side event. Start over with a fresh, non-blocking
+			// query on the next cycle rather than trust a stale index.
+			index = 0
+			continue
+		case nextIndex == index:
+			// The blocking query simply timed out: nothing changed.
+			continue
+		}
+		index = nextIndex
+
+		select {
+		case updates <- consulUpdate{host: host, records: toRecords(host, entries)}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func toRecords(host string, entries []consulCatalogEntry) []Record {
+	var records []Record
+	for _, e := range entries {
+		addrText := e.ServiceAddress
+		if addrText == "" {
+			addrText = e.Address
+		}
+		addr, err := netip.ParseAddr(addrText)
+		if err != nil {
+			continue
+		}
+		records = append(records, Record{IP: addr, Hosts: host})
+	}
+	return records
+}
+
+// mergeRecords flattens per-host record sets into a single slice, ordered
+// by host so that Watch sends a deterministic result for a given input.
+func mergeRecords(byHost map[string][]Record) []Record {
+	hosts := make([]string, 0, len(byHost))
+	for host := range byHost {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var records []Record
+	for _, host := range hosts {
+		records = append(records, byHost[host]...)
+	}
+	return records
+}
+
+func (s *ConsulSource) catalogService(ctx context.Context, service string, waitIndex uint64) ([]consulCatalogEntry, uint64, error) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   s.Addr,
+		Path:   "/v1/catalog/service/" + service,
+	}
+
+	q := u.Query()
+	if waitIndex > 0 {
+		waitTime := s.WaitTime
+		if waitTime == 0 {
+			waitTime = 5 * time.Minute
+		}
+		q.Set("index", strconv.FormatUint(waitIndex, 10))
+		q.Set("wait", waitTime.String())
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("etchosts: consul catalog request for service %q failed: %s", service, resp.Status)
+	}
+
+	var entries []consulCatalogEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, err
+	}
+
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return entries, index, nil
+}
@@ -0,0 +1,174 @@
+package etchosts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func TestConsulSourceRecords(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/v1/catalog/service/web") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Consul-Index", "42")
+		_ = json.NewEncoder(w).Encode([]consulCatalogEntry{
+			{Address: "10.0.0.5"},
+		})
+	}))
+	defer server.Close()
+
+	src := &ConsulSource{
+		Addr:     strings.TrimPrefix(server.URL, "http://"),
+		Services: map[string]string{"web.service.consul": "web"},
+	}
+
+	records, err := src.Records(context.Background())
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(records, 1))
+	assert.Check(t, is.Equal(records[0].Hosts, "web.service.consul"))
+	assert.Check(t, is.Equal(records[0].IP.String(), "10.0.0.5"))
+}
+
+func TestConsulSourceWatchUsesBlockingQuery(t *testing.T) {
+	var index int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		index++
+		w.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		addr := "10.0.0.5"
+		if index > 1 {
+			addr = "10.0.0.6"
+		}
+		_ = json.NewEncoder(w).Encode([]consulCatalogEntry{{Address: addr}})
+	}))
+	defer server.Close()
+
+	src := &ConsulSource{
+		Addr:     strings.TrimPrefix(server.URL, "http://"),
+		Services: map[string]string{"web.service.consul": "web"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := src.Watch(ctx)
+	assert.NilError(t, err)
+
+	first := <-ch
+	assert.Check(t, is.Len(first, 1))
+	assert.Check(t, is.Equal(first[0].IP.String(), "10.0.0.5"))
+
+	second := <-ch
+	assert.Check(t, is.Len(second, 1))
+	assert.Check(t, is.Equal(second[0].IP.String(), "10.0.0.6"))
+}
+
+// TestConsulSourceWatchSkipsUnchangedIndex guards against resyncing on a
+// blocking query that simply timed out: Consul returns the same index and
+// data in that case, and Watch must not treat it as a change.
+func TestConsulSourceWatchSkipsUnchangedIndex(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Consul-Index", "7")
+		_ = json.NewEncoder(w).Encode([]consulCatalogEntry{{Address: "10.0.0.9"}})
+	}))
+	defer server.Close()
+
+	src := &ConsulSource{
+		Addr:     strings.TrimPrefix(server.URL, "http://"),
+		Services: map[string]string{"web.service.consul": "web"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := src.Watch(ctx)
+	assert.NilError(t, err)
+
+	first := <-ch
+	assert.Check(t, is.Len(first, 1))
+	assert.Check(t, is.Equal(first[0].IP.String(), "10.0.0.9"))
+
+	select {
+	case records := <-ch:
+		t.Fatalf("expected no further updates for an unchanged index, got %v", records)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// TestConsulSourceWatchTracksIndexPerService guards against regressing to a
+// single shared index across services: each service must carry forward its
+// own X-Consul-Index, not the maximum seen across all watched services.
+func TestConsulSourceWatchTracksIndexPerService(t *testing.T) {
+	var mu sync.Mutex
+	seenIndex := make(map[string]string)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var service, index string
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/a"):
+			service, index = "a", "100"
+		case strings.HasSuffix(r.URL.Path, "/b"):
+			service, index = "b", "5"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		reqIndex := r.URL.Query().Get("index")
+		w.Header().Set("X-Consul-Index", index)
+		if reqIndex == "" {
+			// Initial, non-blocking request.
+			_ = json.NewEncoder(w).Encode([]consulCatalogEntry{{Address: "10.0.0.1"}})
+			return
+		}
+
+		mu.Lock()
+		seenIndex[service] = reqIndex
+		mu.Unlock()
+
+		// Hold the blocking request open so the test can observe the
+		// index it was called with without racing further cycles.
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	src := &ConsulSource{
+		Addr: strings.TrimPrefix(server.URL, "http://"),
+		Services: map[string]string{
+			"a": "a",
+			"b": "b",
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := src.Watch(ctx)
+	assert.NilError(t, err)
+
+	deadline := time.After(2 * time.Second)
+	for {
+		mu.Lock()
+		done := seenIndex["a"] == "100" && seenIndex["b"] == "5"
+		mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("services did not carry forward independent indexes: %v", seenIndex)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Package etchosts provides utility functions to manage /etc/hosts file.
+package etchosts
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Record represents a single host record in the /etc/hosts file, i.e. an
+// IP address and the whitespace-separated list of hostnames that resolve
+// to it.
+type Record struct {
+	Hosts string
+	IP    netip.Addr
+}
+
+// WriteTo writes r to w in the same tab-separated format used by the rest
+// of the package, and returns the number of bytes written.
+func (r Record) WriteTo(w *bufio.Writer) (int, error) {
+	return fmt.Fprintf(w, "%s\t%s\n", r.IP, r.Hosts)
+}
+
+// defaultContent is the set of records written by Build in addition to
+// whatever extra content the caller supplies.
+var defaultContent = []Record{
+	{IP: netip.MustParseAddr("127.0.0.1"), Hosts: "localhost"},
+	{IP: netip.MustParseAddr("::1"), Hosts: "localhost ip6-localhost ip6-loopback"},
+	{IP: netip.MustParseAddr("fe00::"), Hosts: "ip6-localnet"},
+	{IP: netip.MustParseAddr("ff00::"), Hosts: "ip6-mcastprefix"},
+	{IP: netip.MustParseAddr("ff02::1"), Hosts: "ip6-allnodes"},
+	{IP: netip.MustParseAddr("ff02::2"), Hosts: "ip6-allrouters"},
+}
+
+var (
+	fileMutexesMu sync.Mutex
+	fileMutexes   = make(map[string]*sync.Mutex)
+)
+
+// mutexForPath returns a mutex that is unique to path, creating it if
+// necessary, so that concurrent mutations of the same hosts file are
+// serialized without blocking callers operating on different files.
+func mutexForPath(path string) *sync.Mutex {
+	fileMutexesMu.Lock()
+	defer fileMutexesMu.Unlock()
+
+	m, ok := fileMutexes[path]
+	if !ok {
+		m = &sync.Mutex{}
+		fileMutexes[path] = m
+	}
+	return m
+}
+
+// Build writes a new /etc/hosts file at path containing the default set of
+// records followed by extraContent.
+func Build(path string, extraContent []Record) error {
+	return build(path, defaultContent, extraContent)
+}
+
+// BuildNoIPv6 behaves like Build but omits any IPv6 records, from both the
+// default content and extraContent. It is used for containers that have
+// IPv6 disabled.
+func BuildNoIPv6(path string, extraContent []Record) error {
+	return build(path, onlyIPv4(defaultContent), onlyIPv4(extraContent))
+}
+
+func onlyIPv4(recs []Record) []Record {
+	var out []Record
+	for _, r := range recs {
+		if r.IP.Is4() {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func build(path string, contents ...[]Record) error {
+	m := mutexForPath(path)
+	m.Lock()
+	defer m.Unlock()
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	for _, recs := range contents {
+		for _, r := range recs {
+			if _, err := r.WriteTo(w); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return writeFile(path, buf.Bytes())
+}
+
+// Add appends records to the hosts file at path.
+func Add(path string, records []Record) error {
+	return Mutate(path, records, nil)
+}
+
+// Delete removes records from the hosts file at path. A line is only
+// removed when both its IP and its hosts field match a record to delete
+// exactly, so deleting "prefix" never removes a line for "prefixAndMore".
+func Delete(path string, records []Record) error {
+	return Mutate(path, nil, records)
+}
+
+// Mutate applies del removals and add insertions to the hosts file at path
+// in a single pass: the file is streamed line by line into a temporary
+// file in the same directory, which then replaces path with an atomic
+// rename. Callers doing frequent churn get one file rewrite per batch
+// instead of one per Add/Delete call.
+func Mutate(path string, add, del []Record) error {
+	if len(add) == 0 && len(del) == 0 {
+		return nil
+	}
+
+	m := mutexForPath(path)
+	m.Lock()
+	defer m.Unlock()
+
+	if err := snapshot(path); err != nil {
+		return err
+	}
+
+	if err := mutate(path, add, del); err != nil {
+		_ = restoreLatest(path)
+		return err
+	}
+	return nil
+}
+
+func mutate(path string, add, del []Record) error {
+	toDelete := make(map[string]struct{}, len(del))
+	for _, r := range del {
+		toDelete[recordKey(r.IP.String(), r.Hosts)] = struct{}{}
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		tmp.Close()
+		os.Remove(tmpPath)
+	}()
+
+	w := bufio.NewWriter(tmp)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if ip, hosts, ok := strings.Cut(line, "\t"); ok {
+			if _, deleted := toDelete[recordKey(ip, hosts)]; deleted {
+				continue
+			}
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range add {
+		if _, err := r.WriteTo(w); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(info.Mode()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// Update changes the IP address of the record for hostname to IP, without
+// touching any other record. Only a host whose hosts field contains
+// hostname as a whole token is updated, so updating "prefix" never touches
+// a line for "prefixAndMore".
+func Update(path, IP, hostname string) error {
+	m := mutexForPath(path)
+	m.Lock()
+	defer m.Unlock()
+
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(old))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && hasHostname(fields[1:], hostname) {
+			fmt.Fprintf(&buf, "%s\t%s\n", IP, strings.Join(fields[1:], " "))
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return writeFile(path, buf.Bytes())
+}
+
+func hasHostname(hosts []string, hostname string) bool {
+	for _, h := range hosts {
+		if h == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+func recordKey(ip, hosts string) string {
+	return ip + "\t" + hosts
+}
+
+// List parses the hosts file at path and returns one Record per non-empty,
+// non-comment line, preserving file order. Lines are expected to follow the
+// "IP<tab-or-space>host [host...]" format written by the rest of this
+// package, with all hostnames on a line folded into a single Record. Lines
+// with fewer than two fields or an IP that does not parse are skipped.
+func List(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		ip, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			continue
+		}
+
+		records = append(records, Record{
+			IP:    ip,
+			Hosts: strings.Join(fields[1:], " "),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Lookup returns the IP addresses the hosts file at path associates with
+// hostname. It returns a nil slice, with no error, if hostname is not
+// found.
+func Lookup(path, hostname string) ([]netip.Addr, error) {
+	records, err := List(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []netip.Addr
+	for _, r := range records {
+		if hasHostname(strings.Fields(r.Hosts), hostname) {
+			addrs = append(addrs, r.IP)
+		}
+	}
+	return addrs, nil
+}
+
+// LookupIP returns the hostnames the hosts file at path associates with ip.
+// It returns a nil slice, with no error, if ip is not found.
+func LookupIP(path string, ip netip.Addr) ([]string, error) {
+	records, err := List(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, r := range records {
+		if r.IP == ip {
+			hosts = append(hosts, strings.Fields(r.Hosts)...)
+		}
+	}
+	return hosts, nil
+}
@@ -409,6 +409,117 @@ func TestConcurrentWrites(t *testing.T) {
 	}
 }
 
+func TestList(t *testing.T) {
+	file, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	err = Build(file.Name(), []Record{
+		{
+			Hosts: "example example.com",
+			IP:    netip.MustParseAddr("10.11.12.13"),
+		},
+	})
+	assert.NilError(t, err)
+
+	records, err := List(file.Name())
+	assert.NilError(t, err)
+	checkRecords(t, records, []Record{
+		{Hosts: "localhost", IP: netip.MustParseAddr("127.0.0.1")},
+		{Hosts: "localhost ip6-localhost ip6-loopback", IP: netip.MustParseAddr("::1")},
+		{Hosts: "ip6-localnet", IP: netip.MustParseAddr("fe00::")},
+		{Hosts: "ip6-mcastprefix", IP: netip.MustParseAddr("ff00::")},
+		{Hosts: "ip6-allnodes", IP: netip.MustParseAddr("ff02::1")},
+		{Hosts: "ip6-allrouters", IP: netip.MustParseAddr("ff02::2")},
+		{Hosts: "example example.com", IP: netip.MustParseAddr("10.11.12.13")},
+	})
+}
+
+func TestListSkipsCommentsAndBlankLines(t *testing.T) {
+	file, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	content := "# this is a comment\n\n127.0.0.1\tlocalhost\n\n::1\tlocalhost ip6-localhost ip6-loopback\n"
+	assert.NilError(t, os.WriteFile(file.Name(), []byte(content), 0o644))
+
+	records, err := List(file.Name())
+	assert.NilError(t, err)
+	checkRecords(t, records, []Record{
+		{Hosts: "localhost", IP: netip.MustParseAddr("127.0.0.1")},
+		{Hosts: "localhost ip6-localhost ip6-loopback", IP: netip.MustParseAddr("::1")},
+	})
+}
+
+func TestLookup(t *testing.T) {
+	file, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	err = Build(file.Name(), []Record{
+		{
+			Hosts: "example example.com",
+			IP:    netip.MustParseAddr("10.11.12.13"),
+		},
+	})
+	assert.NilError(t, err)
+
+	addrs, err := Lookup(file.Name(), "example.com")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(addrs, 1))
+	assert.Check(t, is.Equal(addrs[0], netip.MustParseAddr("10.11.12.13")))
+
+	addrs, err = Lookup(file.Name(), "doesnotexist")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(addrs, 0))
+
+	hosts, err := LookupIP(file.Name(), netip.MustParseAddr("10.11.12.13"))
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(hosts, []string{"example", "example.com"}))
+}
+
+func TestMutate(t *testing.T) {
+	file, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	err = Build(file.Name(), []Record{
+		{Hosts: "testhostname1", IP: netip.MustParseAddr("1.1.1.1")},
+		{Hosts: "testhostname2", IP: netip.MustParseAddr("2.2.2.2")},
+	})
+	assert.NilError(t, err)
+
+	err = Mutate(file.Name(),
+		[]Record{{Hosts: "testhostname3", IP: netip.MustParseAddr("3.3.3.3")}},
+		[]Record{{Hosts: "testhostname1", IP: netip.MustParseAddr("1.1.1.1")}},
+	)
+	assert.NilError(t, err)
+
+	content, err := os.ReadFile(file.Name())
+	assert.NilError(t, err)
+
+	assert.Check(t, is.Contains(string(content), "2.2.2.2\ttesthostname2\n"))
+	assert.Check(t, is.Contains(string(content), "3.3.3.3\ttesthostname3\n"))
+	assert.Check(t, !bytes.Contains(content, []byte("1.1.1.1\ttesthostname1\n")))
+}
+
+func checkRecords(t *testing.T, got, want []Record) {
+	t.Helper()
+	assert.Assert(t, is.Len(got, len(want)))
+	for i := range want {
+		assert.Check(t, is.Equal(got[i].IP, want[i].IP))
+		assert.Check(t, is.Equal(got[i].Hosts, want[i].Hosts))
+	}
+}
+
 func benchDelete(b *testing.B) {
 	b.StopTimer()
 	file, err := os.CreateTemp("", "")
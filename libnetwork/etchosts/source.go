@@ -0,0 +1,160 @@
+package etchosts
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Source is an external provider of hosts records, e.g. a service registry.
+// It is reconciled into a hosts file's managed region by Sync and Run.
+type Source interface {
+	// Records returns the current set of records the source knows about.
+	Records(ctx context.Context) ([]Record, error)
+
+	// Watch returns a channel that receives the full set of records
+	// whenever the source's view of them changes. The channel is closed
+	// once ctx is done or the source has nothing further to send.
+	Watch(ctx context.Context) (<-chan []Record, error)
+}
+
+// Managed region markers. Content between them is owned by this package and
+// rewritten on every Sync; everything outside is left untouched so
+// user-authored entries in the hosts file survive reconciliation.
+const (
+	managedBeginMarker = "# BEGIN docker-managed"
+	managedEndMarker   = "# END docker-managed"
+)
+
+// Sync fetches the current records from src and rewrites the managed region
+// of the hosts file at path to match, leaving everything outside the
+// region untouched.
+func Sync(path string, src Source) error {
+	records, err := src.Records(context.Background())
+	if err != nil {
+		return err
+	}
+	return syncRecords(path, records)
+}
+
+// Run calls Sync once and then keeps the managed region of the hosts file
+// at path up to date with src until ctx is done, using src.Watch to learn
+// about changes. It returns nil when ctx is done or src's Watch channel is
+// closed.
+func Run(ctx context.Context, path string, src Source) error {
+	if err := Sync(path, src); err != nil {
+		return err
+	}
+
+	ch, err := src.Watch(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case records, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := syncRecords(path, records); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func syncRecords(path string, records []Record) error {
+	m := mutexForPath(path)
+	m.Lock()
+	defer m.Unlock()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return writeFile(path, mergeManaged(content, records))
+}
+
+// mergeManaged replaces the content between the managed region markers in
+// content with records, appending a new managed region at the end of the
+// file if the markers aren't present yet. Lines outside the region are
+// returned unchanged.
+//
+// If content has a begin marker with no matching end marker (e.g. the file
+// was truncated or hand-edited), the managed region is treated as absent
+// rather than open-ended: every existing line is preserved as-is and a
+// fresh, well-formed managed region is appended, so a missing end marker
+// can never cause user entries to be silently dropped.
+func mergeManaged(content []byte, records []Record) []byte {
+	var lines []string
+	if len(content) > 0 {
+		lines = strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	}
+
+	beginIdx, endIdx := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case managedBeginMarker:
+			// Pair the end marker with the last begin marker before it,
+			// so a stray begin marker left in front of an appended region
+			// never pulls the lines after it into the region.
+			if endIdx == -1 {
+				beginIdx = i
+			}
+		case managedEndMarker:
+			if beginIdx != -1 && endIdx == -1 && i > beginIdx {
+				endIdx = i
+			}
+		}
+	}
+
+	var out []string
+	if beginIdx != -1 && endIdx != -1 {
+		out = make([]string, 0, len(lines)+len(records))
+		out = append(out, lines[:beginIdx+1]...)
+		out = append(out, managedLines(records)...)
+		out = append(out, lines[endIdx:]...)
+	} else {
+		out = make([]string, 0, len(lines)+len(records)+2)
+		out = append(out, lines...)
+		out = append(out, managedBeginMarker)
+		out = append(out, managedLines(records)...)
+		out = append(out, managedEndMarker)
+	}
+
+	return []byte(strings.Join(out, "\n") + "\n")
+}
+
+func managedLines(records []Record) []string {
+	lines := make([]string, 0, len(records))
+	for _, r := range records {
+		lines = append(lines, fmt.Sprintf("%s\t%s", r.IP, r.Hosts))
+	}
+	return lines
+}
+
+// SliceSource is a Source backed by a fixed, unchanging set of records. Its
+// Watch channel never sends, since the content never changes.
+type SliceSource []Record
+
+// Records returns s unchanged.
+func (s SliceSource) Records(ctx context.Context) ([]Record, error) {
+	return s, nil
+}
+
+// Watch returns a channel that only ever closes, once ctx is done.
+func (s SliceSource) Watch(ctx context.Context) (<-chan []Record, error) {
+	ch := make(chan []Record)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
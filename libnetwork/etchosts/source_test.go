@@ -0,0 +1,98 @@
+package etchosts
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func TestSyncWritesManagedRegion(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	assert.NilError(t, os.WriteFile(file, []byte("127.0.0.1\tlocalhost\n# user entry\n10.0.0.1\tuser.example\n"), 0o644))
+
+	src := SliceSource{
+		{Hosts: "service.consul", IP: netip.MustParseAddr("10.1.2.3")},
+	}
+	assert.NilError(t, Sync(file, src))
+
+	content, err := os.ReadFile(file)
+	assert.NilError(t, err)
+
+	s := string(content)
+	assert.Check(t, is.Contains(s, "10.0.0.1\tuser.example"))
+	assert.Check(t, is.Contains(s, managedBeginMarker))
+	assert.Check(t, is.Contains(s, managedEndMarker))
+	assert.Check(t, is.Contains(s, "10.1.2.3\tservice.consul"))
+
+	// A second Sync with different records must replace the managed
+	// region in place, without disturbing the user-authored line.
+	src = SliceSource{
+		{Hosts: "other.consul", IP: netip.MustParseAddr("10.4.5.6")},
+	}
+	assert.NilError(t, Sync(file, src))
+
+	content, err = os.ReadFile(file)
+	assert.NilError(t, err)
+
+	s = string(content)
+	assert.Check(t, is.Contains(s, "10.0.0.1\tuser.example"))
+	assert.Check(t, is.Contains(s, "10.4.5.6\tother.consul"))
+	assert.Check(t, !strings.Contains(s, "service.consul"))
+	assert.Check(t, is.Equal(strings.Count(s, managedBeginMarker), 1))
+}
+
+func TestSyncWithMissingEndMarkerPreservesUserEntries(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	// A begin marker with no matching end marker, as if the file had been
+	// truncated or hand-edited after a managed region was written.
+	assert.NilError(t, os.WriteFile(file, []byte(
+		"127.0.0.1\tlocalhost\n"+managedBeginMarker+"\n10.1.2.3\tservice.consul\n10.0.0.1\tuser.example\n",
+	), 0o644))
+
+	src := SliceSource{{Hosts: "other.consul", IP: netip.MustParseAddr("10.4.5.6")}}
+	assert.NilError(t, Sync(file, src))
+
+	content, err := os.ReadFile(file)
+	assert.NilError(t, err)
+
+	s := string(content)
+	// Nothing that existed before Sync may be dropped, including the
+	// stray begin marker and the lines that used to follow it.
+	assert.Check(t, is.Contains(s, "10.1.2.3\tservice.consul"))
+	assert.Check(t, is.Contains(s, "10.0.0.1\tuser.example"))
+	assert.Check(t, is.Contains(s, "10.4.5.6\tother.consul"))
+	assert.Check(t, is.Equal(strings.Count(s, managedEndMarker), 1))
+}
+
+func TestRunStopsWhenContextDone(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	assert.NilError(t, Build(file, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	src := SliceSource{{Hosts: "service.consul", IP: netip.MustParseAddr("10.1.2.3")}}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, file, src)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NilError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after context cancellation")
+	}
+
+	content, err := os.ReadFile(file)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(content), "service.consul"))
+}